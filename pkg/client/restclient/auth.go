@@ -0,0 +1,286 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultTokenRefreshSkew is how far ahead of a token's expiry the
+// authorizer proactively refreshes it, absent an explicit
+// DefaultTokenAuthorizer.Skew.
+const defaultTokenRefreshSkew = 30 * time.Second
+
+// BearerChallenge is the parsed form of a "WWW-Authenticate: Bearer ..."
+// challenge header, as used by Docker/Harbor style registry token auth.
+type BearerChallenge struct {
+	Realm   string
+	Service string
+	Scope   string
+}
+
+// cacheKey identifies a cached token; tokens are scoped to a
+// (service, scope) pair, so distinct scopes never share a token.
+type cacheKey struct {
+	service string
+	scope   string
+}
+
+// TokenAuthorizer obtains a bearer token satisfying the given challenge,
+// fetching a fresh one (and caching it) as needed.
+type TokenAuthorizer interface {
+	Token(challenge BearerChallenge) (string, error)
+}
+
+// tokenResponse is the subset of a token-endpoint response this package
+// understands; token endpoints are free to use either "token" (Docker)
+// or "access_token" (OAuth2) as the field name.
+type tokenResponse struct {
+	Token       string `json:"token"`
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+	IssuedAt    string `json:"issued_at"`
+}
+
+func (t *tokenResponse) token() string {
+	if t.Token != "" {
+		return t.Token
+	}
+	return t.AccessToken
+}
+
+// cachedToken is a token and the time it stops being usable.
+type cachedToken struct {
+	token  string
+	expiry time.Time
+}
+
+// DefaultTokenAuthorizer is a TokenAuthorizer that authenticates to the
+// challenge's realm with HTTP Basic credentials or a static refresh token,
+// and caches the resulting bearer token per (service, scope) until it is
+// within skew of expiring.
+type DefaultTokenAuthorizer struct {
+	// Username/Password authenticate to the realm with HTTP Basic auth.
+	Username string
+	Password string
+
+	// RefreshToken, if set, is sent instead of Username/Password.
+	RefreshToken string
+
+	// Client issues the token request. Defaults to http.DefaultClient.
+	Client *http.Client
+
+	// Skew is how far ahead of expiry a cached token is treated as
+	// expired, so callers never race a token dying mid-request. Defaults
+	// to defaultTokenRefreshSkew.
+	Skew time.Duration
+
+	mu    sync.Mutex
+	cache map[cacheKey]*cachedToken
+}
+
+// Token implements TokenAuthorizer.
+func (a *DefaultTokenAuthorizer) Token(challenge BearerChallenge) (string, error) {
+	key := cacheKey{service: challenge.Service, scope: challenge.Scope}
+	skew := a.Skew
+	if skew == 0 {
+		skew = defaultTokenRefreshSkew
+	}
+
+	a.mu.Lock()
+	if cached, ok := a.cache[key]; ok && time.Now().Add(skew).Before(cached.expiry) {
+		a.mu.Unlock()
+		return cached.token, nil
+	}
+	a.mu.Unlock()
+
+	tok, expiry, err := a.fetchToken(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	a.mu.Lock()
+	if a.cache == nil {
+		a.cache = map[cacheKey]*cachedToken{}
+	}
+	a.cache[key] = &cachedToken{token: tok, expiry: expiry}
+	a.mu.Unlock()
+
+	return tok, nil
+}
+
+// fetchToken hits the challenge's realm and parses the token response,
+// returning the token and the time it expires at.
+func (a *DefaultTokenAuthorizer) fetchToken(challenge BearerChallenge) (string, time.Time, error) {
+	realm, err := url.Parse(challenge.Realm)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid token realm %q: %v", challenge.Realm, err)
+	}
+	query := realm.Query()
+	if challenge.Service != "" {
+		query.Set("service", challenge.Service)
+	}
+	if challenge.Scope != "" {
+		query.Set("scope", challenge.Scope)
+	}
+	if a.RefreshToken != "" {
+		query.Set("refresh_token", a.RefreshToken)
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest("GET", realm.String(), nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	if a.RefreshToken == "" && a.Username != "" {
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+
+	client := a.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", time.Time{}, fmt.Errorf("token request to %s failed with status %d", realm.Host, resp.StatusCode)
+	}
+
+	var tr tokenResponse
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil {
+		return "", time.Time{}, fmt.Errorf("unable to decode token response: %v", err)
+	}
+	if tr.token() == "" {
+		return "", time.Time{}, fmt.Errorf("token endpoint returned no token")
+	}
+
+	issuedAt := time.Now()
+	if tr.IssuedAt != "" {
+		if parsed, err := time.Parse(time.RFC3339, tr.IssuedAt); err == nil {
+			issuedAt = parsed
+		}
+	}
+	expiresIn := tr.ExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 60
+	}
+	return tr.token(), issuedAt.Add(time.Duration(expiresIn) * time.Second), nil
+}
+
+// parseBearerChallenge parses a "WWW-Authenticate: Bearer realm=...,
+// service=..., scope=..." header value into a BearerChallenge. ok is false
+// if header does not carry a Bearer challenge.
+func parseBearerChallenge(header string) (challenge BearerChallenge, ok bool) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(header, prefix) {
+		return BearerChallenge{}, false
+	}
+
+	params := make(map[string]string)
+	for _, part := range splitChallengeParams(strings.TrimPrefix(header, prefix)) {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		params[strings.TrimSpace(kv[0])] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+
+	challenge = BearerChallenge{
+		Realm:   params["realm"],
+		Service: params["service"],
+		Scope:   params["scope"],
+	}
+	return challenge, challenge.Realm != ""
+}
+
+// splitChallengeParams splits a comma-separated list of key="value" pairs,
+// ignoring commas that appear inside quoted values.
+func splitChallengeParams(s string) []string {
+	var parts []string
+	inQuotes := false
+	last := 0
+	for i, r := range s {
+		switch r {
+		case '"':
+			inQuotes = !inQuotes
+		case ',':
+			if !inQuotes {
+				parts = append(parts, s[last:i])
+				last = i + 1
+			}
+		}
+	}
+	parts = append(parts, s[last:])
+	return parts
+}
+
+// tokenAuthRoundTripper retries a request that came back 401 with a Bearer
+// challenge, using Authorizer to obtain a token for the challenge and
+// attaching it as "Authorization: Bearer <token>" before retrying.
+type tokenAuthRoundTripper struct {
+	authorizer TokenAuthorizer
+	rt         http.RoundTripper
+}
+
+// NewTokenAuthRoundTripper wraps rt so that a 401 response carrying a
+// Bearer challenge triggers exactly one token fetch (via authorizer) and
+// retry of the original request.
+func NewTokenAuthRoundTripper(authorizer TokenAuthorizer, rt http.RoundTripper) http.RoundTripper {
+	return &tokenAuthRoundTripper{authorizer: authorizer, rt: rt}
+}
+
+func (rt *tokenAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := rt.rt.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	challenge, ok := parseBearerChallenge(resp.Header.Get("WWW-Authenticate"))
+	if !ok {
+		return resp, nil
+	}
+
+	token, tokErr := rt.authorizer.Token(challenge)
+	if tokErr != nil {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	retry := cloneRequest(req)
+	// req.Body, if any, was already streamed to the wire by the first
+	// RoundTrip call above; cloneRequest's shallow copy reuses that same
+	// drained reader, so rebuild it from GetBody rather than resending it.
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return resp, nil
+		}
+		retry.Body = body
+	}
+	retry.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	return rt.rt.RoundTrip(retry)
+}
@@ -0,0 +1,222 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restclient
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/apimachinery/registered"
+	"k8s.io/kubernetes/pkg/runtime"
+	"k8s.io/kubernetes/pkg/util/diff"
+)
+
+func TestTokenAuthorizerChallengeAndRefresh(t *testing.T) {
+	var tokenRequests int32
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&tokenRequests, 1)
+		if req.URL.Query().Get("service") != "registry.example.com" || req.URL.Query().Get("scope") != "repository:library/foo:pull" {
+			t.Errorf("unexpected token request query: %s", req.URL.RawQuery)
+		}
+		// issued_at must be recent: the authorizer computes expiry as
+		// issued_at + expires_in, and a token that has already expired is
+		// never served from the cache.
+		fmt.Fprintf(w, `{"token":"s3cr3t","expires_in":3600,"issued_at":%q}`, time.Now().UTC().Format(time.RFC3339))
+	}))
+	defer tokenServer.Close()
+
+	var apiRequests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&apiRequests, 1)
+		if n == 1 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry.example.com",scope="repository:library/foo:pull"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer s3cr3t" {
+			t.Errorf("expected retried request to carry the fetched token, got %q", req.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: apiServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		BearerAuthorizer: &DefaultTokenAuthorizer{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get().Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&apiRequests) != 2 {
+		t.Errorf("expected exactly 2 requests to the API server (challenge + retry), got %d", apiRequests)
+	}
+
+	// A second top-level request for the same (service, scope) must reuse
+	// the cached token rather than hitting the token endpoint again.
+	apiRequests = 0
+	if _, err := c.Get().Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if atomic.LoadInt32(&tokenRequests) != 1 {
+		t.Errorf("expected the token endpoint to be hit exactly once for a cached scope, got %d", tokenRequests)
+	}
+}
+
+func TestTokenAuthorizerRetriesPUTBodyAfterChallenge(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"token":"s3cr3t","expires_in":3600,"issued_at":"2015-01-01T00:00:00Z"}`)
+	}))
+	defer tokenServer.Close()
+
+	payload := `{"hello":"world"}`
+	var bodiesSeen []string
+	var apiRequests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf, _ := ioutil.ReadAll(req.Body)
+		bodiesSeen = append(bodiesSeen, string(buf))
+		if atomic.AddInt32(&apiRequests, 1) == 1 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry.example.com",scope="repository:library/foo:pull"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer s3cr3t" {
+			t.Errorf("expected retried request to carry the fetched token, got %q", req.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer apiServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: apiServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		BearerAuthorizer: &DefaultTokenAuthorizer{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Put().Prefix("test").Body([]byte(payload)).Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(bodiesSeen) != 2 {
+		t.Fatalf("expected challenge + retry, got %d requests", len(bodiesSeen))
+	}
+	for i, got := range bodiesSeen {
+		if got != payload {
+			t.Errorf("request %d: expected body %q, got %q", i, payload, got)
+		}
+	}
+}
+
+func TestTokenAuthorizerStillFailsAfterRefresh(t *testing.T) {
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"token":"s3cr3t","expires_in":3600,"issued_at":"2015-01-01T00:00:00Z"}`)
+	}))
+	defer tokenServer.Close()
+
+	// The challenge is satisfied and a token is fetched successfully, but
+	// the retried request is still rejected by the server (e.g. the token
+	// lacks the needed scope) — this is the "401 after refresh" path.
+	status := &unversioned.Status{
+		Code:    http.StatusUnauthorized,
+		Status:  unversioned.StatusFailure,
+		Reason:  unversioned.StatusReasonUnauthorized,
+		Message: "still unauthorized",
+		Details: &unversioned.StatusDetails{},
+	}
+	statusBody, _ := runtime.Encode(testapi.Default.Codec(), status)
+
+	var apiRequests int32
+	apiServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		n := atomic.AddInt32(&apiRequests, 1)
+		if n == 1 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s",service="registry.example.com",scope="repository:library/foo:pull"`, tokenServer.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer s3cr3t" {
+			t.Errorf("expected retried request to carry the fetched token, got %q", req.Header.Get("Authorization"))
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(statusBody)
+	}))
+	defer apiServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: apiServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		BearerAuthorizer: &DefaultTokenAuthorizer{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	err = c.Get().Do().Error()
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	ss, ok := err.(errors.APIStatus)
+	if !ok {
+		t.Fatalf("expected a 401 to surface as an APIStatus error like TestDoRequestFailed, got %T: %v", err, err)
+	}
+	actual := ss.Status()
+	if !reflect.DeepEqual(status, &actual) {
+		t.Errorf("Unexpected mis-match: %s", diff.ObjectReflectDiff(status, &actual))
+	}
+	if atomic.LoadInt32(&apiRequests) != 2 {
+		t.Errorf("expected exactly 2 requests to the API server (challenge + retry), got %d", apiRequests)
+	}
+}
+
+func TestParseBearerChallenge(t *testing.T) {
+	challenge, ok := parseBearerChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:library/foo:pull,push"`)
+	if !ok {
+		t.Fatalf("expected challenge to parse")
+	}
+	if challenge.Realm != "https://auth.example.com/token" || challenge.Service != "registry.example.com" || challenge.Scope != "repository:library/foo:pull,push" {
+		t.Errorf("unexpected challenge: %#v", challenge)
+	}
+
+	if _, ok := parseBearerChallenge(`Basic realm="foo"`); ok {
+		t.Errorf("expected a non-Bearer challenge not to parse")
+	}
+}
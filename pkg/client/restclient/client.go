@@ -0,0 +1,294 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package restclient provides a client for the Kubernetes API server that
+// speaks the subset of HTTP needed to issue and decode REST requests.
+package restclient
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+// TLSClientConfig contains settings to enable transport layer security
+// between a client and server.
+type TLSClientConfig struct {
+	// Insecure, when true, disables server certificate verification.
+	Insecure bool
+
+	// ServerName is passed to the server for SNI and used by the client to
+	// check server certificates against.
+	ServerName string
+
+	// CertFile/KeyFile are paths to a client cert/key pair used for mutual
+	// TLS authentication.
+	CertFile string
+	KeyFile  string
+
+	// CAFile, if present, overrides the system root CAs.
+	CAFile string
+
+	// CertData/KeyData/CAData hold PEM-encoded data and take precedence over
+	// the corresponding *File fields when set.
+	CertData []byte
+	KeyData  []byte
+	CAData   []byte
+}
+
+// ContentConfig holds the information needed to build requests for a
+// specific API group/version using a particular serializer.
+type ContentConfig struct {
+	// GroupVersion is the API group and version the client is configured for.
+	GroupVersion *unversioned.GroupVersion
+
+	// NegotiatedSerializer is used to pick the serialization to use when
+	// talking to the server.
+	NegotiatedSerializer runtime.NegotiatedSerializer
+
+	// ContentType specifies the wire format used to communicate with the
+	// server. Defaults to "application/json" when empty.
+	ContentType string
+}
+
+// Config holds the common attributes that can be passed to a Kubernetes
+// client on initialization.
+type Config struct {
+	// Host must be a host string, a host:port pair, or a URL to the base of
+	// the API server.
+	Host string
+	// APIPath is the path segment prepended to the group/version when
+	// building request URLs, e.g. "/api" for the legacy core group or
+	// "/apis" for named groups.
+	APIPath string
+
+	ContentConfig
+
+	// Username/Password are used for HTTP Basic authentication.
+	Username string
+	Password string
+
+	// BearerToken, when set, is sent as the Authorization header on every
+	// request instead of Username/Password.
+	BearerToken string
+
+	// BearerAuthorizer, when set, handles 401 challenges carrying a
+	// "WWW-Authenticate: Bearer" header by fetching a token from the
+	// challenge's realm and retrying the request. It takes precedence over
+	// BearerToken on a challenged request.
+	BearerAuthorizer TokenAuthorizer
+
+	TLSClientConfig
+
+	// UserAgent overrides the default User-Agent header sent with requests.
+	UserAgent string
+
+	// Transport can be used to bypass the default round tripper entirely,
+	// e.g. in tests.
+	Transport http.RoundTripper
+
+	// WrapTransport is an ordered chain of decorators applied, each in
+	// turn, on top of the base transport (after TLS, Basic, bearer token,
+	// and BearerAuthorizer have been layered in) to allow callers to
+	// observe or modify requests — tracing spans, latency metrics,
+	// request-id propagation, and so on. WrapTransport[0] wraps the base
+	// transport directly and WrapTransport[len-1] is outermost, so it sees
+	// the final request first.
+	WrapTransport []func(rt http.RoundTripper) http.RoundTripper
+
+	// Timeout, if non-zero, is the overall request timeout applied to the
+	// underlying http.Client.
+	Timeout time.Duration
+
+	// MaxRetries is the number of times a request for an idempotent verb
+	// (GET, HEAD, PUT, DELETE) is retried after a 500, 502, 503 or 504
+	// response or a non-context network error, before the failure is returned to the
+	// caller. Defaults to 0 (no automatic retries); overridable per-request
+	// with Request.MaxRetries.
+	MaxRetries int
+
+	// RetryMinBackoff/RetryMaxBackoff bound the full-jitter sleep applied
+	// between retries: sleep = rand(0, min(RetryMaxBackoff, RetryMinBackoff*2^attempt)).
+	// Zero values fall back to defaultRetryMinBackoff/defaultRetryMaxBackoff.
+	RetryMinBackoff time.Duration
+	RetryMaxBackoff time.Duration
+}
+
+// RESTClient is a Kubernetes client that automatically converts between
+// API resources and structs, and manages the wire-level details of talking
+// to a Kubernetes server.
+type RESTClient struct {
+	base   *url.URL
+	prefix string
+
+	contentConfig ContentConfig
+
+	// backoff is shared by every Request built from this client, so that
+	// failures against a given URL are remembered across calls instead of
+	// being tracked per-request.
+	backoff BackoffManager
+
+	maxRetries      int
+	retryMinBackoff time.Duration
+	retryMaxBackoff time.Duration
+
+	Client *http.Client
+}
+
+// RESTClientFor constructs a RESTClient for use with the given config.
+func RESTClientFor(config *Config) (*RESTClient, error) {
+	if config.GroupVersion == nil {
+		return nil, fmt.Errorf("GroupVersion is required when initializing a RESTClient")
+	}
+	if config.NegotiatedSerializer == nil {
+		return nil, fmt.Errorf("NegotiatedSerializer is required when initializing a RESTClient")
+	}
+
+	baseURL, versionedAPIPath, err := defaultServerUrlFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := TransportFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: transport}
+	if config.Timeout > 0 {
+		client.Timeout = config.Timeout
+	}
+
+	restClient := NewRESTClient(baseURL, versionedAPIPath, config.ContentConfig, client)
+	restClient.maxRetries = config.MaxRetries
+	if config.RetryMinBackoff > 0 {
+		restClient.retryMinBackoff = config.RetryMinBackoff
+	}
+	if config.RetryMaxBackoff > 0 {
+		restClient.retryMaxBackoff = config.RetryMaxBackoff
+	}
+	return restClient, nil
+}
+
+// NewRESTClient creates a new RESTClient. This is the lowest level
+// constructor, intended for callers that have already resolved the base URL
+// and http.Client they want to use.
+func NewRESTClient(baseURL *url.URL, versionedAPIPath string, config ContentConfig, client *http.Client) *RESTClient {
+	base := *baseURL
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	base.RawQuery = ""
+	base.Fragment = ""
+
+	if len(config.ContentType) == 0 {
+		config.ContentType = "application/json"
+	}
+
+	return &RESTClient{
+		base:            &base,
+		prefix:          versionedAPIPath,
+		contentConfig:   config,
+		backoff:         readExpBackoffConfig(),
+		retryMinBackoff: defaultRetryMinBackoff,
+		retryMaxBackoff: defaultRetryMaxBackoff,
+		Client:          client,
+	}
+}
+
+// defaultServerUrlFor parses the Host and APIPath of config into a base URL
+// and the versioned API path to append to every request, e.g.
+// "/api/v1" or "/apis/extensions/v1beta1".
+func defaultServerUrlFor(config *Config) (*url.URL, string, error) {
+	host := config.Host
+	if len(host) == 0 {
+		host = "http://localhost"
+	}
+	base, err := defaultServerUrl(host)
+	if err != nil {
+		return nil, "", err
+	}
+	versionedAPIPath := config.APIPath + "/" + config.GroupVersion.String()
+	return base, versionedAPIPath, nil
+}
+
+// defaultServerUrl converts a host or host:port pair into the base URL to
+// use for every request, defaulting to plain HTTP when no scheme is given.
+func defaultServerUrl(host string) (*url.URL, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host must be a URL or a host:port pair")
+	}
+	hostURL, err := url.Parse(host)
+	if err != nil || hostURL.Scheme == "" || hostURL.Host == "" {
+		hostURL, err = url.Parse("http://" + host)
+		if err != nil {
+			return nil, err
+		}
+		if hostURL.Path != "" && hostURL.Path != "/" {
+			return nil, fmt.Errorf("host must be a URL or a host:port pair: %q", host)
+		}
+	}
+	return hostURL, nil
+}
+
+// Verb begins a request with the given HTTP verb.
+func (c *RESTClient) Verb(verb string) *Request {
+	return NewRequest(c).Verb(verb)
+}
+
+// Post begins a POST request.
+func (c *RESTClient) Post() *Request {
+	return c.Verb("POST")
+}
+
+// Put begins a PUT request.
+func (c *RESTClient) Put() *Request {
+	return c.Verb("PUT")
+}
+
+// Patch begins a PATCH request of the given PatchType.
+func (c *RESTClient) Patch(pt api.PatchType) *Request {
+	return c.Verb("PATCH").SetHeader("Content-Type", string(pt))
+}
+
+// Get begins a GET request.
+func (c *RESTClient) Get() *Request {
+	return c.Verb("GET")
+}
+
+// Delete begins a DELETE request.
+func (c *RESTClient) Delete() *Request {
+	return c.Verb("DELETE")
+}
+
+// GroupVersion returns the API group/version the client was configured for.
+func (c *RESTClient) GroupVersion() unversioned.GroupVersion {
+	return *c.contentConfig.GroupVersion
+}
+
+// Transport returns the fully resolved http.RoundTripper this client sends
+// requests through, including any WrapTransport decorators. Advanced
+// callers can use this to drive the same transport chain outside of the
+// Request builder, e.g. to share it with another HTTP client.
+func (c *RESTClient) Transport() http.RoundTripper {
+	return c.Client.Transport
+}
@@ -17,11 +17,16 @@ limitations under the License.
 package restclient
 
 import (
+	"context"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
 	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -292,6 +297,383 @@ func TestCreateBackoffManager(t *testing.T) {
 
 }
 
+func TestDoContextCanceledMidFlight(t *testing.T) {
+	started := make(chan struct{})
+	unblock := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(started)
+		<-unblock
+	}))
+	defer testServer.Close()
+	defer close(unblock)
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+
+	_, doErr := c.Get().Context(ctx).Do().Raw()
+	if doErr != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", doErr)
+	}
+}
+
+func TestDoContextDeadlineExceeded(t *testing.T) {
+	unblock := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-unblock
+	}))
+	defer testServer.Close()
+	defer close(unblock)
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	_, doErr := c.Get().Context(ctx).Do().Raw()
+	if doErr != context.DeadlineExceeded {
+		t.Errorf("expected context.DeadlineExceeded, got %v", doErr)
+	}
+}
+
+func TestStreamContextCanceledMidRead(t *testing.T) {
+	unblock := make(chan struct{})
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.(http.Flusher).Flush()
+		<-unblock
+	}))
+	defer testServer.Close()
+	defer close(unblock)
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := c.Get().Context(ctx).Stream()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer stream.Close()
+
+	readErr := make(chan error, 1)
+	go func() {
+		_, err := stream.Read(make([]byte, 1))
+		readErr <- err
+	}()
+
+	cancel()
+	select {
+	case err := <-readErr:
+		if err == nil {
+			t.Errorf("expected the in-flight read to fail once the context was canceled")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Read did not unblock after context cancellation")
+	}
+}
+
+func TestStreamContextErrorStatus(t *testing.T) {
+	status := &unversioned.Status{
+		Code:    http.StatusNotFound,
+		Status:  unversioned.StatusFailure,
+		Reason:  unversioned.StatusReasonNotFound,
+		Message: " \"\" not found",
+		Details: &unversioned.StatusDetails{},
+	}
+	expectedBody, _ := runtime.Encode(testapi.Default.Codec(), status)
+	fakeHandler := utiltesting.FakeHandler{
+		StatusCode:   404,
+		ResponseBody: string(expectedBody),
+		T:            t,
+	}
+	testServer := httptest.NewServer(&fakeHandler)
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, streamErr := c.Get().Stream()
+	if streamErr == nil {
+		t.Fatalf("expected an error")
+	}
+	ss, ok := streamErr.(errors.APIStatus)
+	if !ok {
+		t.Fatalf("expected a 404 to decode as errors.APIStatus, got %T: %v", streamErr, streamErr)
+	}
+	actual := ss.Status()
+	if !reflect.DeepEqual(status, &actual) {
+		t.Errorf("Unexpected mis-match: %s", diff.ObjectReflectDiff(status, &actual))
+	}
+}
+
+func TestRequestBodySetsContentLength(t *testing.T) {
+	var gotContentLength int64
+	var gotBody string
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		gotContentLength = req.ContentLength
+		buf, _ := ioutil.ReadAll(req.Body)
+		gotBody = string(buf)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := []byte(`{"hello":"world"}`)
+	if _, err := c.Put().Prefix("test").Body(payload).Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotContentLength != int64(len(payload)) {
+		t.Errorf("expected Content-Length %d, got %d (body was likely sent chunked)", len(payload), gotContentLength)
+	}
+	if gotBody != string(payload) {
+		t.Errorf("expected body %q, got %q", payload, gotBody)
+	}
+}
+
+func TestBackoffShortCircuitsOnCanceledContext(t *testing.T) {
+	os.Setenv(envBackoffBase, "100")
+	os.Setenv(envBackoffDuration, "100")
+	defer os.Setenv(envBackoffBase, "")
+	defer os.Setenv(envBackoffDuration, "")
+
+	testServer, _, _ := testServerEnv(t, 200)
+	defer testServer.Close()
+
+	c, err := restClient(testServer)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	theUrl, _ := url.Parse(testServer.URL)
+	c.backoff.UpdateBackoff(theUrl, fmt.Errorf("boom"), 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	_, doErr := c.Get().Context(ctx).Do().Raw()
+	if doErr != context.Canceled {
+		t.Errorf("expected context.Canceled, got %v", doErr)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("expected backoff to be skipped for an already-canceled context, took %v", elapsed)
+	}
+}
+
+func TestDoRetriesOn503ThenSucceeds(t *testing.T) {
+	var requests int32
+	var attemptTimes []time.Time
+	var mu sync.Mutex
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attemptTimes = append(attemptTimes, time.Now())
+		mu.Unlock()
+		n := atomic.AddInt32(&requests, 1)
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: testServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		MaxRetries:      5,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get().Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Fatalf("expected exactly 3 requests (2 failures + success), got %d", got)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attemptTimes) != 3 {
+		t.Fatalf("expected 3 recorded attempts, got %d", len(attemptTimes))
+	}
+	if !attemptTimes[1].After(attemptTimes[0]) || !attemptTimes[2].After(attemptTimes[1]) {
+		t.Errorf("expected attempts to be spaced apart by backoff sleeps, got %v", attemptTimes)
+	}
+}
+
+func TestDoRetriesHonorRetryAfterHeader(t *testing.T) {
+	var requests int32
+	var attemptTimes []time.Time
+	var mu sync.Mutex
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		attemptTimes = append(attemptTimes, time.Now())
+		mu.Unlock()
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: testServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		// A tiny jittered fallback (at most 1ms) makes it obvious the
+		// observed delay came from the Retry-After header (~1s) and not the
+		// fallback.
+		MaxRetries:      5,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get().Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(attemptTimes) != 2 {
+		t.Fatalf("expected 2 attempts, got %d", len(attemptTimes))
+	}
+	if delay := attemptTimes[1].Sub(attemptTimes[0]); delay < 900*time.Millisecond {
+		t.Errorf("expected the retry to wait for the Retry-After: 1 header (~1s), only waited %v", delay)
+	}
+}
+
+func TestRetryAfterParsesDeltaSecondsAndHTTPDate(t *testing.T) {
+	resp := &http.Response{Header: http.Header{}}
+
+	resp.Header.Set("Retry-After", "2")
+	if got, want := retryAfter(resp, time.Millisecond), 2*time.Second; got != want {
+		t.Errorf("delta-seconds: got %v, want %v", got, want)
+	}
+
+	resp.Header.Set("Retry-After", time.Now().Add(3*time.Second).UTC().Format(http.TimeFormat))
+	if got := retryAfter(resp, time.Millisecond); got <= time.Second || got > 3*time.Second {
+		t.Errorf("HTTP-date: got %v, want roughly 3s", got)
+	}
+
+	resp.Header.Del("Retry-After")
+	if got, want := retryAfter(resp, 42*time.Millisecond), 42*time.Millisecond; got != want {
+		t.Errorf("no header: got %v, want fallback %v", got, want)
+	}
+}
+
+func TestDoRetriesResendPlainReaderBody(t *testing.T) {
+	var requests int32
+	var bodiesSeen []string
+	var mu sync.Mutex
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		buf, _ := ioutil.ReadAll(req.Body)
+		mu.Lock()
+		bodiesSeen = append(bodiesSeen, string(buf))
+		mu.Unlock()
+		n := atomic.AddInt32(&requests, 1)
+		if n <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: testServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		MaxRetries:      5,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := `{"hello":"world"}`
+	// A plain io.Reader that does not also implement io.Seeker, to exercise
+	// the buffering path rather than the seek-and-rewind path.
+	body := ioutil.NopCloser(strings.NewReader(payload))
+	if _, err := c.Put().Prefix("test").Body(body).Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(bodiesSeen) != 3 {
+		t.Fatalf("expected 3 attempts, got %d", len(bodiesSeen))
+	}
+	for i, got := range bodiesSeen {
+		if got != payload {
+			t.Errorf("attempt %d: expected body %q, got %q", i, payload, got)
+		}
+	}
+}
+
+func TestDoDoesNotRetryPostByDefault(t *testing.T) {
+	var requests int32
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer testServer.Close()
+
+	c, err := RESTClientFor(&Config{
+		Host: testServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		MaxRetries:      5,
+		RetryMinBackoff: time.Millisecond,
+		RetryMaxBackoff: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	c.Post().Do()
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("expected POST not to be retried by default, got %d requests", got)
+	}
+}
+
 func testServerEnv(t *testing.T, statusCode int) (*httptest.Server, *utiltesting.FakeHandler, *unversioned.Status) {
 	status := &unversioned.Status{Status: fmt.Sprintf("%s", unversioned.StatusSuccess)}
 	expectedBody, _ := runtime.Encode(testapi.Default.Codec(), status)
@@ -0,0 +1,616 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/errors"
+	"k8s.io/kubernetes/pkg/runtime"
+)
+
+const (
+	// defaultRetryMinBackoff/defaultRetryMaxBackoff bound the full-jitter
+	// sleep between automatic retries when Config doesn't override them.
+	defaultRetryMinBackoff = 500 * time.Millisecond
+	defaultRetryMaxBackoff = 5 * time.Second
+)
+
+// retriableStatusCodes are the 5xx responses worth retrying; 501 Not
+// Implemented is deliberately excluded since retrying it can never
+// succeed.
+var retriableStatusCodes = map[int]bool{
+	http.StatusInternalServerError: true,
+	http.StatusBadGateway:          true,
+	http.StatusServiceUnavailable:  true,
+	http.StatusGatewayTimeout:      true,
+}
+
+const (
+	// envBackoffBase is the initial backoff, in seconds, applied to a URL
+	// the first time it fails. Unset or non-numeric disables backoff.
+	envBackoffBase = "KUBE_CLIENT_BACKOFF_BASE"
+	// envBackoffDuration caps, in seconds, how long backoff for a single URL
+	// may grow to.
+	envBackoffDuration = "KUBE_CLIENT_BACKOFF_DURATION"
+)
+
+// BackoffManager tracks per-URL backoff so that repeated failures against
+// the same server slow down retries instead of hammering it.
+type BackoffManager interface {
+	UpdateBackoff(actualURL *url.URL, err error, responseCode int)
+	CalculateBackoff(actualURL *url.URL) time.Duration
+}
+
+// NoBackoff is a BackoffManager that never delays.
+type NoBackoff struct{}
+
+func (n *NoBackoff) UpdateBackoff(actualURL *url.URL, err error, responseCode int) {}
+
+func (n *NoBackoff) CalculateBackoff(actualURL *url.URL) time.Duration {
+	return 0 * time.Second
+}
+
+// urlBackoffEntry tracks the exponential backoff state for a single host.
+// duration is the wait CalculateBackoff will hand back until expiry
+// passes, at which point the entry is stale and treated as reset.
+type urlBackoffEntry struct {
+	duration time.Duration
+	expiry   time.Time
+}
+
+// urlBackoff is an exponential, per-host BackoffManager bounded by a
+// maximum duration. It is configured via readExpBackoffConfig.
+type urlBackoff struct {
+	sync.Mutex
+
+	base string
+	max  time.Duration
+
+	entries map[string]*urlBackoffEntry
+}
+
+func (b *urlBackoff) key(actualURL *url.URL) string {
+	if actualURL == nil {
+		return ""
+	}
+	return actualURL.Host
+}
+
+func (b *urlBackoff) UpdateBackoff(actualURL *url.URL, err error, responseCode int) {
+	b.Lock()
+	defer b.Unlock()
+
+	if b.max <= 0 {
+		return
+	}
+	if responseCode >= 500 || err != nil {
+		key := b.key(actualURL)
+		entry, ok := b.entries[key]
+		if !ok {
+			entry = &urlBackoffEntry{}
+			b.entries[key] = entry
+		}
+		entry.duration = b.next(entry.duration)
+		entry.expiry = time.Now().Add(entry.duration)
+		return
+	}
+	delete(b.entries, b.key(actualURL))
+}
+
+// next doubles the previous backoff duration, seeding it from base on the
+// first failure and capping it at max.
+func (b *urlBackoff) next(previous time.Duration) time.Duration {
+	base, err := time.ParseDuration(b.base + "s")
+	if err != nil || base <= 0 {
+		return 0
+	}
+	d := previous * 2
+	if d < base {
+		d = base
+	}
+	if d > b.max {
+		d = b.max
+	}
+	return d
+}
+
+func (b *urlBackoff) CalculateBackoff(actualURL *url.URL) time.Duration {
+	b.Lock()
+	defer b.Unlock()
+
+	entry, ok := b.entries[b.key(actualURL)]
+	if !ok || time.Now().After(entry.expiry) {
+		return 0
+	}
+	return entry.duration
+}
+
+// readExpBackoffConfig reads the KUBE_CLIENT_BACKOFF_BASE/DURATION
+// environment variables and returns a BackoffManager configured
+// accordingly, falling back to NoBackoff when they are unset or invalid.
+func readExpBackoffConfig() BackoffManager {
+	backoffBase := os.Getenv(envBackoffBase)
+	backoffDuration := os.Getenv(envBackoffDuration)
+
+	backoffBaseInt, errBase := strconv.ParseInt(backoffBase, 10, 64)
+	backoffDurationInt, errDuration := strconv.ParseInt(backoffDuration, 10, 64)
+	if errBase != nil || errDuration != nil {
+		return &NoBackoff{}
+	}
+	return &urlBackoff{
+		base:    strconv.FormatInt(backoffBaseInt, 10),
+		max:     time.Duration(backoffDurationInt) * time.Second,
+		entries: map[string]*urlBackoffEntry{},
+	}
+}
+
+// Request allows for building up a request to a server in a chained fashion.
+// Any errors are stored until the end of your call, so you only have to
+// check once.
+type Request struct {
+	c *RESTClient
+
+	ctx context.Context
+
+	backoff BackoffManager
+
+	verb string
+	path string
+
+	params  url.Values
+	headers http.Header
+
+	body io.Reader
+	err  error
+
+	// maxRetries overrides c.maxRetries for this request; -1 means unset.
+	maxRetries int
+	// retryPost opts a POST request in to automatic retries, which are
+	// otherwise skipped for it since POST is not idempotent.
+	retryPost bool
+}
+
+// NewRequest creates a new request against the given RESTClient.
+func NewRequest(c *RESTClient) *Request {
+	return &Request{
+		c:          c,
+		ctx:        context.Background(),
+		backoff:    c.backoff,
+		path:       c.prefix,
+		params:     url.Values{},
+		headers:    http.Header{},
+		maxRetries: -1,
+	}
+}
+
+// Verb sets the HTTP verb for the request.
+func (r *Request) Verb(verb string) *Request {
+	r.verb = verb
+	return r
+}
+
+// Context installs ctx on the request. The context governs cancellation of
+// the in-flight HTTP call made by Do, DoRaw, and Stream; a nil ctx is
+// rejected the same way net/http rejects one.
+func (r *Request) Context(ctx context.Context) *Request {
+	if ctx == nil {
+		r.err = fmt.Errorf("nil context passed to Request.Context")
+		return r
+	}
+	r.ctx = ctx
+	return r
+}
+
+// MaxRetries overrides, for this request only, the number of times a 500,
+// 502, 503 or 504 response or network error is retried before being
+// returned to the caller. It has no effect on POST unless combined with RetryPost.
+func (r *Request) MaxRetries(n int) *Request {
+	r.maxRetries = n
+	return r
+}
+
+// RetryPost opts this request in to automatic retries even though its
+// verb is POST. Automatic retries are otherwise limited to the idempotent
+// verbs (GET, HEAD, PUT, DELETE), since resending a POST can duplicate a
+// side effect the first, seemingly-failed attempt actually completed.
+func (r *Request) RetryPost() *Request {
+	r.retryPost = true
+	return r
+}
+
+// Prefix appends segments to the request path, ahead of any later
+// Resource/Name segments.
+func (r *Request) Prefix(segments ...string) *Request {
+	r.path = path(r.path, segments...)
+	return r
+}
+
+// Param adds a query parameter to the request.
+func (r *Request) Param(name, value string) *Request {
+	r.params.Add(name, value)
+	return r
+}
+
+// SetHeader sets a header on the underlying http.Request.
+func (r *Request) SetHeader(name, value string) *Request {
+	r.headers.Set(name, value)
+	return r
+}
+
+// Body sets the request body. Accepted types are raw bytes ([]byte) and
+// io.Reader; any other type, a runtime.Object included, is not encoded and
+// instead records an "unknown body type" error on the request.
+//
+// A plain io.Reader that doesn't also implement io.Seeker is read to
+// completion and buffered here, rather than stored as-is: retryable
+// requests (see retriable) resend the body on every attempt, and a
+// reader that was already drained by attempt one would otherwise go out
+// silently empty on attempt two instead of erroring or rewinding.
+func (r *Request) Body(obj interface{}) *Request {
+	switch t := obj.(type) {
+	case []byte:
+		r.body = bytes.NewReader(t)
+	case io.Reader:
+		if _, ok := t.(io.Seeker); ok {
+			r.body = t
+			break
+		}
+		data, err := ioutil.ReadAll(t)
+		if err != nil {
+			r.err = fmt.Errorf("unable to buffer request body: %v", err)
+			break
+		}
+		r.body = bytes.NewReader(data)
+	default:
+		r.err = fmt.Errorf("unknown body type %T", obj)
+	}
+	return r
+}
+
+func path(base string, segments ...string) string {
+	for _, s := range segments {
+		if s == "" {
+			continue
+		}
+		base = strings.TrimRight(base, "/") + "/" + strings.TrimLeft(s, "/")
+	}
+	return base
+}
+
+// URL returns the current working URL of the request.
+func (r *Request) URL() *url.URL {
+	u := *r.c.base
+	u.Path = singleJoiningSlash(r.c.base.Path, r.path)
+	u.RawQuery = r.params.Encode()
+	return &u
+}
+
+func singleJoiningSlash(a, b string) string {
+	aslash := strings.HasSuffix(a, "/")
+	bslash := strings.HasPrefix(b, "/")
+	switch {
+	case aslash && bslash:
+		return a + b[1:]
+	case !aslash && !bslash:
+		return a + "/" + b
+	}
+	return a + b
+}
+
+// bodyReader returns the request body for this attempt, rewound so it can
+// be safely resent. The concrete reader is returned unwrapped so that
+// http.NewRequest's own type switch on *bytes.Reader/*bytes.Buffer/
+// *strings.Reader can still detect it and set ContentLength/GetBody;
+// wrapping it here (e.g. in ioutil.NopCloser) would hide that type from
+// http.NewRequest and force every request with a body into chunked
+// encoding with no GetBody.
+func (r *Request) bodyReader() (io.Reader, error) {
+	if r.body == nil {
+		return nil, nil
+	}
+	if seeker, ok := r.body.(io.Seeker); ok {
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+	return r.body, nil
+}
+
+// newHTTPRequest builds the *http.Request for this attempt, with r.ctx
+// installed so the transport can observe cancellation/deadlines.
+func (r *Request) newHTTPRequest() (*http.Request, error) {
+	body, err := r.bodyReader()
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(r.verb, r.URL().String(), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = r.headers
+	return req.WithContext(r.ctx), nil
+}
+
+// retriable reports whether this request's verb is allowed to be
+// automatically retried. GET/HEAD/PUT/DELETE are idempotent and always
+// eligible; POST is only eligible once the caller calls RetryPost.
+func (r *Request) retriable() bool {
+	switch r.verb {
+	case "GET", "HEAD", "PUT", "DELETE":
+		return true
+	case "POST":
+		return r.retryPost
+	default:
+		return false
+	}
+}
+
+// effectiveMaxRetries returns the per-request MaxRetries override if one
+// was set, otherwise the client's default.
+func (r *Request) effectiveMaxRetries() int {
+	if r.maxRetries >= 0 {
+		return r.maxRetries
+	}
+	return r.c.maxRetries
+}
+
+// retryBackoff returns a full-jitter sleep duration for the given attempt
+// (0-indexed): rand(0, min(max, base*2^attempt)).
+func (r *Request) retryBackoff(attempt int) time.Duration {
+	base := r.c.retryMinBackoff
+	max := r.c.retryMaxBackoff
+	if base <= 0 {
+		base = defaultRetryMinBackoff
+	}
+	if max <= 0 {
+		max = defaultRetryMaxBackoff
+	}
+	ceiling := base << uint(attempt)
+	if ceiling <= 0 || ceiling > max { // guard against overflow from a large attempt count
+		ceiling = max
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// retryAfter returns the server-specified Retry-After delay, if resp
+// carries one (as delta-seconds or an HTTP-date), otherwise fallback.
+func retryAfter(resp *http.Response, fallback time.Duration) time.Duration {
+	v := resp.Header.Get("Retry-After")
+	if v == "" {
+		return fallback
+	}
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		return time.Duration(secs) * time.Second
+	}
+	if when, err := http.ParseTime(v); err == nil {
+		if d := time.Until(when); d > 0 {
+			return d
+		}
+	}
+	return fallback
+}
+
+// sleep waits for d, bounded by r.ctx. It returns false if the context
+// finished first, in which case the caller should give up and surface
+// r.ctx.Err() rather than keep retrying.
+func (r *Request) sleep(d time.Duration) bool {
+	if d <= 0 {
+		return r.ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-r.ctx.Done():
+		return false
+	}
+}
+
+// request executes the HTTP round trip for this request, transparently
+// retrying idempotent verbs on a 5xx response listed in
+// retriableStatusCodes or a non-context network
+// error, honoring any Retry-After header and spacing attempts apart with
+// full-jitter backoff so a shared control plane isn't hit in lockstep. A
+// transport error that is actually the context finishing is translated to
+// the context's own sentinel error rather than the wrapped *url.Error —
+// this lets callers distinguish "I cancelled this" from "the server is
+// down" with a plain == check against context.Canceled /
+// context.DeadlineExceeded.
+func (r *Request) request() (*http.Response, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	if err := r.ctx.Err(); err != nil {
+		return nil, err
+	}
+	// This is the legacy per-URL backoff recorded by UpdateBackoff below: it
+	// delays the next separate Do() call against a URL that has recently
+	// failed, so it belongs outside the retry loop. The per-attempt sleeps
+	// inside the loop (r.retryBackoff / retryAfter) are the new, unrelated
+	// mechanism that spaces out automatic retries within a single Do() call;
+	// stacking both on every retry would sleep twice per attempt.
+	if wait := r.backoff.CalculateBackoff(r.URL()); wait > 0 {
+		if !r.sleep(wait) {
+			return nil, r.ctx.Err()
+		}
+	}
+
+	maxRetries := r.effectiveMaxRetries()
+	for attempt := 0; ; attempt++ {
+		if err := r.ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		req, err := r.newHTTPRequest()
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := r.c.Client.Do(req)
+		if err != nil {
+			if ctxErr := r.ctx.Err(); ctxErr != nil {
+				r.backoff.UpdateBackoff(r.URL(), ctxErr, 0)
+				return nil, ctxErr
+			}
+			r.backoff.UpdateBackoff(r.URL(), err, 0)
+			if attempt >= maxRetries || !r.retriable() {
+				return nil, err
+			}
+			if !r.sleep(r.retryBackoff(attempt)) {
+				return nil, r.ctx.Err()
+			}
+			continue
+		}
+
+		r.backoff.UpdateBackoff(r.URL(), nil, resp.StatusCode)
+		if retriableStatusCodes[resp.StatusCode] && attempt < maxRetries && r.retriable() {
+			resp.Body.Close()
+			if !r.sleep(retryAfter(resp, r.retryBackoff(attempt))) {
+				return nil, r.ctx.Err()
+			}
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// Do formats and executes the request, returning a Result that can be
+// checked for errors and transformed into the decoded body.
+func (r *Request) Do() Result {
+	return r.DoContext(r.ctx)
+}
+
+// DoContext is like Do but executes the request with ctx instead of
+// whatever Context() previously installed.
+func (r *Request) DoContext(ctx context.Context) Result {
+	r.ctx = ctx
+	resp, err := r.request()
+	if err != nil {
+		return Result{err: err}
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Result{err: err}
+	}
+	return r.transformResponse(resp, body)
+}
+
+// Raw formats and executes the request, returning the raw response body.
+func (r *Request) Raw() ([]byte, error) {
+	return r.Do().Raw()
+}
+
+// DoRaw formats and executes the request, returning the raw response body.
+func (r *Request) DoRaw() ([]byte, error) {
+	return r.RawContext(r.ctx)
+}
+
+// RawContext is like DoRaw but executes the request with ctx.
+func (r *Request) RawContext(ctx context.Context) ([]byte, error) {
+	return r.DoContext(ctx).Raw()
+}
+
+// Stream formats and executes the request and returns the raw response
+// body as a stream for callers that want to consume it incrementally
+// (e.g. watches).
+func (r *Request) Stream() (io.ReadCloser, error) {
+	return r.StreamContext(r.ctx)
+}
+
+// StreamContext is like Stream but executes the request with ctx. The
+// returned stream is bound to ctx: cancelling ctx unblocks any read that is
+// currently in flight.
+func (r *Request) StreamContext(ctx context.Context) (io.ReadCloser, error) {
+	r.ctx = ctx
+	resp, err := r.request()
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return nil, err
+		}
+		return nil, r.transformResponse(resp, body).Error()
+	}
+	return resp.Body, nil
+}
+
+// transformResponse converts an API response into a structured result,
+// decoding a non-2xx body into the errors.APIStatus the server sent.
+func (r *Request) transformResponse(resp *http.Response, body []byte) Result {
+	if resp.StatusCode >= http.StatusOK && resp.StatusCode <= http.StatusPartialContent {
+		return Result{
+			body:    body,
+			created: resp.StatusCode == http.StatusCreated,
+		}
+	}
+
+	out, decodeErr := runtime.Decode(r.c.contentConfig.NegotiatedSerializer.DecoderToVersion(nil, nil), body)
+	if decodeErr != nil || out == nil {
+		return Result{
+			body: body,
+			err:  errors.NewInternalError(fmt.Errorf("unable to decode %d response: %v", resp.StatusCode, decodeErr)),
+		}
+	}
+	return Result{
+		body: body,
+		err:  errors.FromObject(out),
+	}
+}
+
+// Result contains the result of calling Request.Do().
+type Result struct {
+	body    []byte
+	err     error
+	created bool
+}
+
+// Raw returns the raw result body, and any error encountered while making
+// the request or interpreting the response.
+func (r Result) Raw() ([]byte, error) {
+	return r.body, r.err
+}
+
+// Error returns the error executing the request, nil if no error occurred.
+func (r Result) Error() error {
+	return r.err
+}
+
+// WasCreated updates *created to true if the response status was 201
+// Created, and returns the Result unmodified for chaining.
+func (r Result) WasCreated(created *bool) Result {
+	*created = r.created
+	return r
+}
@@ -0,0 +1,185 @@
+/*
+Copyright 2014 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restclient
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"time"
+)
+
+// TransportFor returns an http.RoundTripper for the given config, applying
+// TLS settings, basic/bearer authentication, and any WrapTransport the
+// caller supplied, in that order.
+func TransportFor(config *Config) (http.RoundTripper, error) {
+	if config.Transport != nil {
+		return wrapTransport(config, config.Transport), nil
+	}
+
+	tlsConfig, err := tlsConfigFor(config)
+	if err != nil {
+		return nil, err
+	}
+
+	rt := http.RoundTripper(&http.Transport{
+		TLSClientConfig: tlsConfig,
+		Dial: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).Dial,
+	})
+
+	rt = NewBasicAuthRoundTripper(config.Username, config.Password, rt)
+	if len(config.BearerToken) > 0 {
+		rt = NewBearerAuthRoundTripper(config.BearerToken, rt)
+	}
+	if config.BearerAuthorizer != nil {
+		rt = NewTokenAuthRoundTripper(config.BearerAuthorizer, rt)
+	}
+
+	return wrapTransport(config, rt), nil
+}
+
+// wrapTransport applies each decorator in config.WrapTransport, in order,
+// on top of rt. WrapTransport[0] wraps rt directly; each subsequent
+// decorator wraps the previous result, so the last entry is outermost and
+// sees a request first.
+func wrapTransport(config *Config, rt http.RoundTripper) http.RoundTripper {
+	for _, wrap := range config.WrapTransport {
+		rt = wrap(rt)
+	}
+	return rt
+}
+
+// tlsConfigFor builds a *tls.Config from the TLS settings on config, or
+// returns nil if none were specified (so the transport falls back to plain
+// HTTP or the default TLS config).
+func tlsConfigFor(config *Config) (*tls.Config, error) {
+	c := config.TLSClientConfig
+	if !c.Insecure && len(c.CAFile) == 0 && len(c.CAData) == 0 && len(c.CertFile) == 0 && len(c.CertData) == 0 {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: c.Insecure,
+		ServerName:         c.ServerName,
+	}
+
+	if len(c.CAData) > 0 || len(c.CAFile) > 0 {
+		caData := c.CAData
+		if len(caData) == 0 {
+			data, err := ioutil.ReadFile(c.CAFile)
+			if err != nil {
+				return nil, err
+			}
+			caData = data
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caData) {
+			return nil, fmt.Errorf("unable to load root certificates from the given CA")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(c.CertData) > 0 || len(c.CertFile) > 0 {
+		certData, keyData := c.CertData, c.KeyData
+		var err error
+		if len(certData) == 0 {
+			certData, err = ioutil.ReadFile(c.CertFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if len(keyData) == 0 {
+			keyData, err = ioutil.ReadFile(c.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		cert, err := tls.X509KeyPair(certData, keyData)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// basicAuthRoundTripper attaches HTTP Basic auth credentials to every
+// request before delegating to the wrapped RoundTripper.
+type basicAuthRoundTripper struct {
+	username string
+	password string
+	rt       http.RoundTripper
+}
+
+// NewBasicAuthRoundTripper wraps rt with HTTP Basic authentication. If
+// username is empty, rt is returned unmodified.
+func NewBasicAuthRoundTripper(username, password string, rt http.RoundTripper) http.RoundTripper {
+	if len(username) == 0 {
+		return rt
+	}
+	return &basicAuthRoundTripper{username, password, rt}
+}
+
+func (rt *basicAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("Authorization")) != 0 {
+		return rt.rt.RoundTrip(req)
+	}
+	req = cloneRequest(req)
+	req.SetBasicAuth(rt.username, rt.password)
+	return rt.rt.RoundTrip(req)
+}
+
+// bearerAuthRoundTripper attaches a static bearer token to every request
+// before delegating to the wrapped RoundTripper.
+type bearerAuthRoundTripper struct {
+	bearer string
+	rt     http.RoundTripper
+}
+
+// NewBearerAuthRoundTripper wraps rt with a static "Authorization: Bearer"
+// header.
+func NewBearerAuthRoundTripper(bearer string, rt http.RoundTripper) http.RoundTripper {
+	return &bearerAuthRoundTripper{bearer, rt}
+}
+
+func (rt *bearerAuthRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if len(req.Header.Get("Authorization")) != 0 {
+		return rt.rt.RoundTrip(req)
+	}
+	req = cloneRequest(req)
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", rt.bearer))
+	return rt.rt.RoundTrip(req)
+}
+
+// cloneRequest returns a shallow copy of req with a deep-copied Header, so
+// RoundTrippers can mutate headers without racing the caller.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	r.Header = make(http.Header, len(req.Header))
+	for k, s := range req.Header {
+		r.Header[k] = append([]string(nil), s...)
+	}
+	return r
+}
@@ -0,0 +1,58 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// LoggingRoundTripper emits a structured one-line summary of every request
+// and response at the configured verbosity, in the style of glog.V-gated
+// logging used elsewhere in this codebase.
+type LoggingRoundTripper struct {
+	// Verbosity is the glog.V level the summary is logged at.
+	Verbosity glog.Level
+
+	wrapped http.RoundTripper
+}
+
+// NewLoggingRoundTripper wraps rt, logging a summary of each request and
+// response at glog.V(verbosity).
+func NewLoggingRoundTripper(rt http.RoundTripper, verbosity glog.Level) http.RoundTripper {
+	return &LoggingRoundTripper{wrapped: rt, Verbosity: verbosity}
+}
+
+func (t *LoggingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !glog.V(t.Verbosity) {
+		return t.wrapped.RoundTrip(req)
+	}
+
+	start := time.Now()
+	glog.V(t.Verbosity).Infof("%s %s", req.Method, req.URL.String())
+
+	resp, err := t.wrapped.RoundTrip(req)
+	latency := time.Since(start)
+	if err != nil {
+		glog.V(t.Verbosity).Infof("%s %s failed after %v: %v", req.Method, req.URL.String(), latency, err)
+		return resp, err
+	}
+	glog.V(t.Verbosity).Infof("%s %s %d in %v", req.Method, req.URL.String(), resp.StatusCode, latency)
+	return resp, err
+}
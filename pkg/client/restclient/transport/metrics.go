@@ -0,0 +1,121 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package transport holds RoundTripper decorators meant to be installed via
+// restclient.Config.WrapTransport: MetricsRoundTripper for latency/result
+// observability and LoggingRoundTripper for structured request logging.
+package transport
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// LatencyMetric receives one observation per completed (or failed) request.
+// verb is the HTTP method; path is the request path with namespace names
+// and UIDs collapsed into placeholders, so requests against different
+// instances of the same resource fall into one series; statusCode is 0 if
+// the round trip never got a response.
+type LatencyMetric interface {
+	Observe(verb, path string, statusCode int, latency time.Duration)
+}
+
+// MetricsRoundTripper records verb/path/status/latency for every request
+// it forwards, without altering the request or response.
+type MetricsRoundTripper struct {
+	rt      http.RoundTripper
+	metrics LatencyMetric
+}
+
+// NewMetricsRoundTripper wraps rt so that every round trip is reported to
+// metrics.
+func NewMetricsRoundTripper(rt http.RoundTripper, metrics LatencyMetric) http.RoundTripper {
+	return &MetricsRoundTripper{rt: rt, metrics: metrics}
+}
+
+func (t *MetricsRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.rt.RoundTrip(req)
+	latency := time.Since(start)
+
+	statusCode := 0
+	if resp != nil {
+		statusCode = resp.StatusCode
+	}
+	t.metrics.Observe(req.Method, canonicalPath(req.URL.Path), statusCode, latency)
+	return resp, err
+}
+
+var uidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// collectionPattern matches a segment shaped like a Kubernetes resource
+// collection name: lowercase, alphanumeric, plural ("pods", "services",
+// "configmaps", ...), the convention REST resource collections in this API
+// follow. A segment that is not a plural word is not matched.
+var collectionPattern = regexp.MustCompile(`^[a-z][a-z0-9]*s$`)
+
+// apiPrefixLen returns how many leading segments of a split path are the
+// structural "api/<version>" or "apis/<group>/<version>" prefix, which
+// must never be mistaken for a resource collection even though group
+// names like "apps" or "extensions" happen to look plural.
+func apiPrefixLen(segments []string) int {
+	if len(segments) == 0 {
+		return 0
+	}
+	switch segments[0] {
+	case "api":
+		return 2
+	case "apis":
+		return 3
+	default:
+		return 0
+	}
+}
+
+// canonicalPath collapses the parts of a request path that vary per
+// resource instance into fixed placeholders, so
+// "/api/v1/namespaces/kube-system/pods/nginx-abc123" and
+// "/api/v1/namespaces/default/pods/frontend-xyz789" both report under the
+// same series:
+//
+//   - UIDs anywhere become "{uid}"
+//   - the namespace name, which always immediately follows a "namespaces"
+//     segment, becomes "{namespace}"
+//   - the instance name immediately following any resource or subresource
+//     collection segment (a lowercase plural word, outside of the
+//     api/group/version prefix) becomes "{name}"
+//
+// This is a naming-convention heuristic, not a real API-discovery-backed
+// path matcher: a collection whose name happens not to be a plain plural
+// noun, or a non-resource verb segment like "watch"/"proxy"/"log", can
+// still slip through uncollapsed.
+func canonicalPath(p string) string {
+	segments := strings.Split(strings.Trim(p, "/"), "/")
+	prefixLen := apiPrefixLen(segments)
+	for i, seg := range segments {
+		switch {
+		case uidPattern.MatchString(seg):
+			segments[i] = "{uid}"
+		case i > 0 && segments[i-1] == "namespaces":
+			segments[i] = "{namespace}"
+		case i > prefixLen && collectionPattern.MatchString(segments[i-1]):
+			segments[i] = "{name}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
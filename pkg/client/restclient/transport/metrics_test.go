@@ -0,0 +1,92 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package transport
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type fakeLatencyMetric struct {
+	verb       string
+	path       string
+	statusCode int
+	observed   bool
+}
+
+func (f *fakeLatencyMetric) Observe(verb, path string, statusCode int, latency time.Duration) {
+	f.verb = verb
+	f.path = path
+	f.statusCode = statusCode
+	f.observed = true
+}
+
+func TestMetricsRoundTripperObservesVerbPathAndStatus(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	defer testServer.Close()
+
+	metrics := &fakeLatencyMetric{}
+	rt := NewMetricsRoundTripper(http.DefaultTransport, metrics)
+
+	req, err := http.NewRequest("GET", testServer.URL+"/api/v1/namespaces/kube-system/pods/nginx-abc123", nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := rt.RoundTrip(req); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !metrics.observed {
+		t.Fatalf("expected an observation to be recorded")
+	}
+	if metrics.verb != "GET" {
+		t.Errorf("expected verb GET, got %s", metrics.verb)
+	}
+	if metrics.statusCode != http.StatusTeapot {
+		t.Errorf("expected status %d, got %d", http.StatusTeapot, metrics.statusCode)
+	}
+	if want := "/api/v1/namespaces/{namespace}/pods/{name}"; metrics.path != want {
+		t.Errorf("expected path %q, got %q", want, metrics.path)
+	}
+}
+
+func TestCanonicalPathCollapsesUIDs(t *testing.T) {
+	in := "/api/v1/namespaces/default/pods/550e8400-e29b-41d4-a716-446655440000"
+	want := "/api/v1/namespaces/{namespace}/pods/{uid}"
+	if got := canonicalPath(in); got != want {
+		t.Errorf("canonicalPath(%q) = %q, want %q", in, got, want)
+	}
+}
+
+func TestCanonicalPathCollapsesResourceNames(t *testing.T) {
+	cases := map[string]string{
+		"/api/v1/namespaces/kube-system/pods/nginx-abc123":      "/api/v1/namespaces/{namespace}/pods/{name}",
+		"/api/v1/nodes/node-1":                                  "/api/v1/nodes/{name}",
+		"/api/v1/namespaces/default/pods/nginx-abc123/status":   "/api/v1/namespaces/{namespace}/pods/{name}/status",
+		"/apis/apps/v1/namespaces/default/deployments/frontend": "/apis/apps/v1/namespaces/{namespace}/deployments/{name}",
+		"/apis/apps/v1/deployments/frontend":                    "/apis/apps/v1/deployments/{name}",
+	}
+	for in, want := range cases {
+		if got := canonicalPath(in); got != want {
+			t.Errorf("canonicalPath(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
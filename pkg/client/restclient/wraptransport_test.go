@@ -0,0 +1,97 @@
+/*
+Copyright 2015 The Kubernetes Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package restclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/testapi"
+	"k8s.io/kubernetes/pkg/apimachinery/registered"
+)
+
+// recordingRoundTripper appends its name to a shared log on every round
+// trip, so a chain of them reveals the order they were invoked in, and
+// captures the final request it saw for header/URL assertions.
+type recordingRoundTripper struct {
+	name string
+	log  *[]string
+	seen **http.Request
+	rt   http.RoundTripper
+}
+
+func (r *recordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	*r.log = append(*r.log, r.name)
+	*r.seen = req
+	return r.rt.RoundTrip(req)
+}
+
+func TestWrapTransportChainWrapsInDeclaredOrder(t *testing.T) {
+	testServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer testServer.Close()
+
+	var log []string
+	var lastSeen *http.Request
+
+	c, err := RESTClientFor(&Config{
+		Host: testServer.URL,
+		ContentConfig: ContentConfig{
+			GroupVersion:         &registered.GroupOrDie(api.GroupName).GroupVersion,
+			NegotiatedSerializer: testapi.Default.NegotiatedSerializer(),
+		},
+		WrapTransport: []func(http.RoundTripper) http.RoundTripper{
+			func(rt http.RoundTripper) http.RoundTripper {
+				return &recordingRoundTripper{name: "first", log: &log, seen: &lastSeen, rt: rt}
+			},
+			func(rt http.RoundTripper) http.RoundTripper {
+				return &recordingRoundTripper{name: "second", log: &log, seen: &lastSeen, rt: rt}
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if _, err := c.Get().Prefix("test").SetHeader("X-Test", "yes").Do().Raw(); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// "second" is outermost (it wraps the result of "first"), so it is
+	// invoked first as the request flows outside-in to the transport.
+	if len(log) != 2 || log[0] != "second" || log[1] != "first" {
+		t.Errorf("expected wrappers invoked outside-in as [second first], got %v", log)
+	}
+
+	if lastSeen == nil {
+		t.Fatalf("expected a request to have been observed")
+	}
+	if lastSeen.Header.Get("X-Test") != "yes" {
+		t.Errorf("expected wrapper to see the final request headers, got %v", lastSeen.Header)
+	}
+	if !strings.HasSuffix(lastSeen.URL.Path, "/test") {
+		t.Errorf("expected wrapper to see the final resolved URL, got %s", lastSeen.URL.Path)
+	}
+
+	if c.Transport() == nil {
+		t.Errorf("expected RESTClient.Transport() to return the resolved transport")
+	}
+}